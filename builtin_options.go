@@ -0,0 +1,93 @@
+package telnet
+
+// Option codes for the built-in handlers below. OPT_COMPRESS2, OPT_NAWS,
+// OPT_TTYPE and friends are declared in data_reader.go / event_reader.go.
+const (
+	OPT_BINARY = 0
+	OPT_ECHO   = 1
+	OPT_SGA    = 3
+	OPT_EOR    = 25
+)
+
+// NewCompress2Handler returns the built-in handler for OPT_COMPRESS2 (86):
+// it simply agrees to enable MCCP2 when asked. readSubnegotiation handles
+// the actual switch-over to a zlib stream once the subnegotiation arrives,
+// since that's a change to the reader itself rather than something an
+// OptionHandler callback can do.
+func NewCompress2Handler() OptionHandler {
+	return NoopOptionHandler{}
+}
+
+// NewEchoHandler returns the built-in handler for ECHO (1): it agrees to
+// enable the option in either direction and takes no further action.
+func NewEchoHandler() OptionHandler {
+	return NoopOptionHandler{}
+}
+
+// NewSuppressGoAheadHandler returns the built-in handler for
+// SUPPRESS-GO-AHEAD (3): it agrees to enable the option in either
+// direction and takes no further action.
+func NewSuppressGoAheadHandler() OptionHandler {
+	return NoopOptionHandler{}
+}
+
+// NewBinaryHandler returns the built-in handler for BINARY (0): it agrees
+// to enable the option in either direction and takes no further action.
+func NewBinaryHandler() OptionHandler {
+	return NoopOptionHandler{}
+}
+
+// NewEORHandler returns the built-in handler for END-OF-RECORD (25): it
+// agrees to enable the option in either direction and takes no further
+// action.
+func NewEORHandler() OptionHandler {
+	return NoopOptionHandler{}
+}
+
+// A NAWSHandler is the built-in handler for NAWS (31). It agrees to enable
+// the option and tracks the most recently negotiated window size in W/H.
+type NAWSHandler struct {
+	NoopOptionHandler
+
+	W, H int
+}
+
+// NewNAWSHandler returns a ready-to-register NAWSHandler.
+func NewNAWSHandler() *NAWSHandler {
+	return &NAWSHandler{}
+}
+
+// OnSubnegotiation decodes the NAWS payload (two 16-bit big-endian
+// integers: width, then height) into W and H.
+func (h *NAWSHandler) OnSubnegotiation(payload []byte) error {
+	if len(payload) < 4 {
+		return errCorrupted
+	}
+	h.W = int(payload[0])<<8 | int(payload[1])
+	h.H = int(payload[2])<<8 | int(payload[3])
+	return nil
+}
+
+// A TTypeHandler is the built-in handler for TTYPE (24). It agrees to
+// enable the option and tracks the most recently announced terminal type
+// in Name.
+type TTypeHandler struct {
+	NoopOptionHandler
+
+	Name string
+}
+
+// NewTTypeHandler returns a ready-to-register TTypeHandler.
+func NewTTypeHandler() *TTypeHandler {
+	return &TTypeHandler{}
+}
+
+// OnSubnegotiation decodes the TTYPE payload (an IS/SEND marker byte
+// followed by the ASCII terminal name) into Name.
+func (h *TTypeHandler) OnSubnegotiation(payload []byte) error {
+	if len(payload) < 1 {
+		return errCorrupted
+	}
+	h.Name = string(payload[1:])
+	return nil
+}
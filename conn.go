@@ -0,0 +1,208 @@
+package telnet
+
+import (
+	"bytes"
+	"net"
+	"time"
+)
+
+// A Conn is a net.Conn that transparently handles TELNET IAC escaping,
+// option negotiation, and MCCP2/MCCP3 compression on top of an underlying
+// connection. Its Read and Write behave like a plain net.Conn's; use
+// RegisterOption to react to option negotiation, and EnableCompress2 or
+// EnableCompress3 to start outbound compression. The Conn's EventReader is
+// not exported, so its EnableLocal/EnableRemote family cannot be called
+// from outside this package.
+type Conn struct {
+	net.Conn
+
+	events *EventReader
+	writer *DataWriter
+}
+
+// newConn wraps an already-established net.Conn with the TELNET layer.
+func newConn(c net.Conn) *Conn {
+	events := NewEventReader(c)
+	writer := NewDataWriter(c, events)
+
+	return &Conn{
+		Conn:   c,
+		events: events,
+		writer: writer,
+	}
+}
+
+// Dial connects to addr on network (see net.Dial) and wraps the connection
+// in a Conn.
+func Dial(network, addr string) (*Conn, error) {
+	c, err := net.Dial(network, addr)
+	if nil != err {
+		return nil, err
+	}
+	return newConn(c), nil
+}
+
+// DialTimeout is like Dial, but with a timeout (see net.DialTimeout).
+func DialTimeout(network, addr string, timeout time.Duration) (*Conn, error) {
+	c, err := net.DialTimeout(network, addr, timeout)
+	if nil != err {
+		return nil, err
+	}
+	return newConn(c), nil
+}
+
+// Read reads un-escaped TELNET data; option negotiation and subnegotiation
+// are interpreted (and consumed) along the way. See EventReader for a way
+// to observe them instead.
+func (c *Conn) Read(data []byte) (int, error) {
+	return c.events.reader.Read(data)
+}
+
+// Write escapes data per the TELNET protocol and writes it to the
+// connection; see DataWriter.
+func (c *Conn) Write(data []byte) (int, error) {
+	return c.writer.Write(data)
+}
+
+// RegisterOption installs h as the handler for opt; see OptionHandler.
+func (c *Conn) RegisterOption(opt byte, h OptionHandler) {
+	c.events.RegisterOption(opt, h)
+}
+
+// SetCRLFMode toggles rewriting outbound "\n" to "\r\n"; see
+// DataWriter.SetCRLFMode.
+func (c *Conn) SetCRLFMode(enabled bool) {
+	c.writer.SetCRLFMode(enabled)
+}
+
+// EnableCompress3 asks the peer to let us compress our outbound data
+// (MCCP3); see DataWriter.EnableCompress3.
+func (c *Conn) EnableCompress3() error {
+	return c.writer.EnableCompress3()
+}
+
+// EnableCompress2 asks the peer to let us compress our outbound data
+// (MCCP2); see DataWriter.EnableCompress2. A telnet/MUD server calls this
+// on its own Conn, since COMPRESS2 compresses server-to-client traffic.
+func (c *Conn) EnableCompress2() error {
+	return c.writer.EnableCompress2()
+}
+
+// Compressed reports whether reads from this Conn are currently being
+// decompressed (MCCP2).
+func (c *Conn) Compressed() bool {
+	return c.events.Compressed()
+}
+
+// Compress2Metrics returns the number of raw bytes read from the connection
+// since the first COMPRESS2 stream began (bytesIn), and the number of
+// decompressed bytes produced (bytesOut). Both are totals over every
+// COMPRESS2 stream on the connection and are never reset.
+func (c *Conn) Compress2Metrics() (bytesIn, bytesOut int64) {
+	return c.events.Compress2Metrics()
+}
+
+// ReadUntil reads until one of delims appears in the stream, returning
+// everything read up to and including the matching delimiter.
+func (c *Conn) ReadUntil(delims ...string) ([]byte, error) {
+	data, _, err := c.ReadUntilIndex(delims...)
+	return data, err
+}
+
+// ReadUntilIndex is like ReadUntil, but also reports which delimiter
+// matched (-1 if err is non-nil and none did).
+func (c *Conn) ReadUntilIndex(delims ...string) ([]byte, int, error) {
+	var buf []byte
+	one := make([]byte, 1)
+
+	for {
+		n, err := c.Read(one)
+		if n > 0 {
+			buf = append(buf, one[0])
+			for i, delim := range delims {
+				if len(delim) > 0 && bytes.HasSuffix(buf, []byte(delim)) {
+					return buf, i, nil
+				}
+			}
+		}
+		if nil != err {
+			return buf, -1, err
+		}
+	}
+}
+
+// ReadLine reads a single line, stripping a trailing "\r\n" or "\n". Any
+// embedded application data is preserved; TELNET commands are never part
+// of it, since Read already consumes them.
+func (c *Conn) ReadLine() ([]byte, error) {
+	line, _, err := c.ReadUntilIndex("\n")
+	if nil != err && 0 == len(line) {
+		return nil, err
+	}
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+
+	return line, err
+}
+
+// A Server accepts incoming TELNET connections, wrapping each in a Conn
+// and performing an initial option negotiation before handing it back.
+type Server struct {
+	net.Listener
+
+	// RequestNAWS causes Accept to also request the client's window
+	// size (option 31) on each new connection.
+	RequestNAWS bool
+
+	// Negotiate, if non-nil, replaces Accept's default negotiation
+	// (offering COMPRESS2, and requesting NAWS if RequestNAWS is set).
+	Negotiate func(*Conn) error
+}
+
+// Listen listens on network/addr (see net.Listen) and returns a Server
+// that wraps each accepted connection in a Conn.
+func Listen(network, addr string) (*Server, error) {
+	l, err := net.Listen(network, addr)
+	if nil != err {
+		return nil, err
+	}
+	return &Server{Listener: l}, nil
+}
+
+// Accept waits for the next incoming connection, wraps it in a Conn, runs
+// the server's negotiation, and returns it.
+func (s *Server) Accept() (*Conn, error) {
+	c, err := s.Listener.Accept()
+	if nil != err {
+		return nil, err
+	}
+
+	conn := newConn(c)
+
+	if nil != s.Negotiate {
+		if err := s.Negotiate(conn); nil != err {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	// COMPRESS2 compresses data flowing server -> client, so it's the
+	// server's own ("us") option to offer, not one to request of the
+	// client; see DataWriter.EnableCompress2.
+	if err := conn.EnableCompress2(); nil != err {
+		conn.Close()
+		return nil, err
+	}
+
+	if s.RequestNAWS {
+		conn.events.RegisterOption(OPT_NAWS, NewNAWSHandler())
+		if err := conn.events.EnableRemote(OPT_NAWS); nil != err {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
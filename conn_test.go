@@ -0,0 +1,222 @@
+package telnet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestConnReadLine(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := newConn(client)
+
+	go func() {
+		server.Write([]byte("hello\r\nworld"))
+	}()
+
+	line, err := conn.ReadLine()
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if "hello" != string(line) {
+		t.Fatalf("got %q, want %q", line, "hello")
+	}
+}
+
+func TestConnWriteEscapesIAC(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := newConn(client)
+
+	done := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 4)
+		n, _ := server.Read(buf)
+		done <- buf[:n]
+	}()
+
+	if _, err := conn.Write([]byte{1, IAC, 2}); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := <-done
+	if want := []byte{1, IAC, IAC, 2}; !bytes.Equal(want, got) {
+		t.Fatalf("wrote %v, want %v", got, want)
+	}
+}
+
+func TestConnReadUntilIndex(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := newConn(client)
+
+	go func() {
+		server.Write([]byte("name: bob\n"))
+	}()
+
+	data, i, err := conn.ReadUntilIndex(": ", "\n")
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if 0 != i {
+		t.Fatalf("matched delimiter %d, want 0", i)
+	}
+	if want := "name: "; want != string(data) {
+		t.Fatalf("got %q, want %q", data, want)
+	}
+}
+
+func TestConnRegisterOptionNegotiatesNAWS(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	conn := newConn(client)
+	h := NewNAWSHandler()
+	conn.RegisterOption(OPT_NAWS, h)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 3)
+		if _, err := server.Read(buf); nil != err {
+			return
+		}
+		// buf is "IAC DO NAWS"; agree with "IAC WILL NAWS" followed by a
+		// window-size subnegotiation.
+		server.Write([]byte{IAC, WILL, OPT_NAWS})
+		server.Write([]byte{IAC, SB, OPT_NAWS, 0, 80, 0, 24, IAC, SE})
+	}()
+
+	if err := conn.events.EnableRemote(OPT_NAWS); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ev, err := conn.events.NextEvent()
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := ev.(WillEvent); !ok {
+		t.Fatalf("got %#v, want WillEvent", ev)
+	}
+
+	ev, err = conn.events.NextEvent()
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := ev.(NAWSEvent); !ok {
+		t.Fatalf("got %#v, want NAWSEvent", ev)
+	}
+	if 80 != h.W || 24 != h.H {
+		t.Fatalf("handler saw W=%d H=%d, want 80x24", h.W, h.H)
+	}
+
+	<-done
+}
+
+// pipeListener is a net.Listener backed by a single net.Pipe connection, so
+// Server tests can drive Accept without opening a real socket.
+type pipeListener struct {
+	conns chan net.Conn
+}
+
+func newPipeListener(server net.Conn) *pipeListener {
+	l := &pipeListener{conns: make(chan net.Conn, 1)}
+	l.conns <- server
+	return l
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	c, ok := <-l.conns
+	if !ok {
+		return nil, io.EOF
+	}
+	return c, nil
+}
+
+func (l *pipeListener) Close() error   { return nil }
+func (l *pipeListener) Addr() net.Addr { return pipeAddr{} }
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// TestServerAcceptOffersCompress2 pins down the direction of Server.Accept's
+// default negotiation: COMPRESS2 compresses server -> client traffic, so
+// the server must offer it with WILL (not request it with DO), and once the
+// client agrees, everything the server writes afterward must actually
+// arrive as a zlib stream.
+func TestServerAcceptOffersCompress2(t *testing.T) {
+	rawServer, rawClient := net.Pipe()
+	server := &Server{Listener: newPipeListener(rawServer)}
+
+	acceptErr := make(chan error, 1)
+	go func() {
+		conn, err := server.Accept()
+		if nil != err {
+			acceptErr <- err
+			return
+		}
+		defer conn.Close()
+
+		// Process the client's "IAC DO COMPRESS2" reply; this is what
+		// drives the Q Method state machine into calling OnEnableLocal
+		// and starting the writer-side zlib stream.
+		if _, err := conn.events.NextEvent(); nil != err {
+			acceptErr <- err
+			return
+		}
+
+		if _, err := conn.Write([]byte("hello")); nil != err {
+			acceptErr <- err
+			return
+		}
+		acceptErr <- nil
+	}()
+
+	will := make([]byte, 3)
+	if _, err := io.ReadFull(rawClient, will); nil != err {
+		t.Fatalf("unexpected error reading WILL: %v", err)
+	}
+	if want := []byte{IAC, WILL, OPT_COMPRESS2}; !bytes.Equal(want, will) {
+		t.Fatalf("got %v, want %v (server must offer, not request, COMPRESS2)", will, want)
+	}
+
+	if _, err := rawClient.Write([]byte{IAC, DO, OPT_COMPRESS2}); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	announce := make([]byte, len(compress2Announce))
+	if _, err := io.ReadFull(rawClient, announce); nil != err {
+		t.Fatalf("unexpected error reading announcement: %v", err)
+	}
+	if !bytes.Equal(compress2Announce, announce) {
+		t.Fatalf("got %v, want %v", announce, compress2Announce)
+	}
+
+	zr, err := zlib.NewReader(rawClient)
+	if nil != err {
+		t.Fatalf("unexpected error opening zlib stream: %v", err)
+	}
+	got := make([]byte, len("hello"))
+	if _, err := io.ReadFull(zr, got); nil != err {
+		t.Fatalf("unexpected error reading zlib stream: %v", err)
+	}
+	if "hello" != string(got) {
+		t.Fatalf("decompressed %q, want %q", got, "hello")
+	}
+
+	if err := <-acceptErr; nil != err {
+		t.Fatalf("server goroutine error: %v", err)
+	}
+}
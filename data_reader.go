@@ -68,9 +68,50 @@ var (
 // ... to this:
 //
 //	[]byte{1, 55, 2, 155, 3, 255, 4, 40, 255, 30, 20}
+//
+// Internally, internalDataReader parses the stream through nextEvent, a
+// small state machine that also understands option negotiation and
+// subnegotiation; Read simply discards every Event that isn't a DataEvent.
+// See EventReader for a way to observe the rest.
 type internalDataReader struct {
 	wrapped  io.ReadWriter
 	buffered *bufio.Reader
+
+	// pending holds DataEvent bytes left over from a previous nextEvent
+	// call that didn't fit in the caller's Read buffer.
+	pending []byte
+
+	// sawIAC is set when nextEvent has already consumed a leading IAC
+	// byte (in order to flush accumulated data) but hasn't read the
+	// command that follows it yet.
+	sawIAC bool
+
+	// options and handlers back the RFC 1143 Q Method negotiation state
+	// machine; see options.go.
+	options  map[byte]*optionState
+	handlers map[byte]OptionHandler
+
+	// compressed is true while buffered is backed by a COMPRESS2 zlib
+	// stream rather than reading wrapped directly.
+	compressed bool
+
+	// compressedBytesIn counts raw bytes read from the connection from the
+	// start of the first COMPRESS2 stream on; decompressedBytesOut counts
+	// bytes produced by the zlib streams. Both are totals over every
+	// COMPRESS2 stream and are never reset; see Compress2Metrics.
+	compressedBytesIn    int64
+	decompressedBytesOut int64
+
+	// rawSource is the bufio.Reader handed to zlib.NewReader for the
+	// current or most recent COMPRESS2 stream. compress/flate only reads a source reader one
+	// byte at a time if it already implements io.ByteReader; otherwise it
+	// silently wraps it in a bufio.Reader of its own and may read ahead
+	// past the end of the deflate stream. Handing zlib a bufio.Reader
+	// directly avoids that hidden buffer, and readByte reuses this same
+	// instance as r.buffered once the stream ends, so any bytes it
+	// already read ahead of the "IAC SE" restart announcement aren't
+	// stranded in a buffer we then discard.
+	rawSource *bufio.Reader
 }
 
 // newDataReader creates a new DataReader reading from 'r'.
@@ -82,153 +123,282 @@ func newDataReader(rw io.ReadWriter) *internalDataReader {
 		buffered: buffered,
 	}
 
+	// COMPRESS2 has always been auto-accepted by this package; preserve
+	// that by registering its handler by default.
+	reader.RegisterOption(OPT_COMPRESS2, NewCompress2Handler())
+
 	return &reader
 }
 
-// Read reads the TELNET escaped data from the  wrapped io.Reader, and "un-escapes" it into 'data'.
+// Compressed reports whether the reader is currently decompressing a
+// COMPRESS2 (MCCP2) stream.
+func (r *internalDataReader) Compressed() bool {
+	return r.compressed
+}
+
+// Compress2Metrics returns the number of raw bytes read from the connection
+// since the first COMPRESS2 stream began (bytesIn), and the number of
+// decompressed bytes produced (bytesOut). Both are totals over every
+// COMPRESS2 stream on the connection and are never reset.
+func (r *internalDataReader) Compress2Metrics() (bytesIn, bytesOut int64) {
+	return r.compressedBytesIn, r.decompressedBytesOut
+}
+
+// readByte reads the next raw byte, falling back to uncompressed reads if
+// a COMPRESS2 stream ends unexpectedly. Some MUDs periodically re-send
+// "IAC SB COMPRESS2 IAC SE" to reset the zlib dictionary rather than
+// keeping one stream open for the life of the connection; when that
+// happens the old zlib.Reader reports io.EOF, and the bytes that follow it
+// are the plain, uncompressed announcement of a new stream.
+func (r *internalDataReader) readByte() (byte, error) {
+	b, err := r.buffered.ReadByte()
+	if nil != err && r.compressed && io.EOF == err {
+		r.buffered = r.rawSource
+		r.compressed = false
+		return r.buffered.ReadByte()
+	}
+	return b, err
+}
+
+// Read reads the TELNET escaped data from the wrapped io.Reader, and "un-escapes" it into 'data'.
+//
+// Option negotiation and subnegotiation are interpreted internally and
+// never surface here; use EventReader if the caller needs to observe them.
 func (r *internalDataReader) Read(data []byte) (n int, err error) {
-	p := data
+	if len(r.pending) > 0 {
+		n = copy(data, r.pending)
+		r.pending = r.pending[n:]
+		return n, nil
+	}
 
-	for len(p) > 0 {
-		var b byte
+	for {
+		var ev Event
+		ev, err = r.nextEvent()
+		if nil != err {
+			return 0, err
+		}
 
-		if n > 0 && r.buffered.Buffered() < 1 {
-			break
+		de, ok := ev.(DataEvent)
+		if !ok {
+			continue
 		}
 
-		b, err = r.buffered.ReadByte()
-		if nil != err {
-			return n, err
+		n = copy(data, de.Data)
+		if n < len(de.Data) {
+			r.pending = append(r.pending, de.Data[n:]...)
 		}
+		return n, nil
+	}
+}
 
-		if IAC == b {
-			var peeked []byte
+// nextEvent reads and returns the next Event from the stream: a run of
+// plain data as a DataEvent, or a negotiation/subnegotiation event produced
+// by readCommand.
+func (r *internalDataReader) nextEvent() (Event, error) {
+	if r.sawIAC {
+		r.sawIAC = false
+		return r.readCommand()
+	}
 
-			peeked, err = r.buffered.Peek(1)
-			if nil != err {
-				return n, err
+	var data []byte
+
+	for {
+		b, err := r.readByte()
+		if nil != err {
+			if len(data) > 0 {
+				return DataEvent{Data: data}, nil
 			}
+			return nil, err
+		}
 
-			switch peeked[0] {
-			case DO, DONT:
-				_, err = r.buffered.Discard(2)
-				if nil != err {
-					return n, err
-				}
-			case WILL, WONT:
-				_, err = r.buffered.Discard(1)
-				if nil != err {
-					return n, err
-				}
-				opt, err := r.buffered.Peek(1)
-				if nil != err {
-					return n, err
-				}
-				err = r.handleOption(opt[0])
-				if nil != err {
-					return n, err
-				}
-				_, err = r.buffered.Discard(1)
-				if nil != err {
-					return n, err
-				}
-			case IAC:
-				p[0] = IAC
-				n++
-				p = p[1:]
-
-				_, err = r.buffered.Discard(1)
-				if nil != err {
-					return n, err
-				}
-			case SB:
-				for {
-					var b2 byte
-					b2, err = r.buffered.ReadByte()
-					if nil != err {
-						return n, err
-					}
-
-					switch b2 {
-					case IAC:
-						peeked, err = r.buffered.Peek(1)
-						if nil != err {
-							return n, err
-						}
-
-						if IAC == peeked[0] {
-							_, err = r.buffered.Discard(1)
-							if nil != err {
-								return n, err
-							}
-						}
-
-						if SE == peeked[0] {
-							_, err = r.buffered.Discard(1)
-							if nil != err {
-								return n, err
-							}
-							break
-						}
-					case OPT_COMPRESS2:
-						//IAC
-						_, err = r.buffered.ReadByte()
-						if nil != err {
-							return n, err
-						}
-						//SE
-						_, err = r.buffered.ReadByte()
-						if nil != err {
-							return n, err
-						}
-						zReader, err := zlib.NewReader(r.wrapped)
-						if nil != err {
-							return n, err
-						}
-						r.buffered = bufio.NewReader(zReader)
-						break
-					}
-				}
-			case SE:
-				_, err = r.buffered.Discard(1)
-				if nil != err {
-					return n, err
-				}
-			case GA:
-				_, err = r.buffered.Discard(1)
-				if nil != err {
-					return n, err
-				}
-				break
-			default:
-				// If we get in here, this is not following the TELNET protocol.
-				//@TODO: Make a better error.
-				err = errCorrupted
-				return n, err
+		if IAC == b {
+			if len(data) > 0 {
+				r.sawIAC = true
+				return DataEvent{Data: data}, nil
 			}
-		} else {
+			return r.readCommand()
+		}
 
-			p[0] = b
-			n++
-			p = p[1:]
+		data = append(data, b)
+		if r.buffered.Buffered() < 1 {
+			return DataEvent{Data: data}, nil
 		}
 	}
-
-	return n, nil
 }
 
-func (r *internalDataReader) handleOption(opt byte) error {
-	switch opt {
-	case OPT_COMPRESS2:
-		_, err := r.wrapped.Write([]byte{IAC, DO, opt})
-		if err != nil {
-			return err
+// readCommand is called immediately after an IAC byte has been consumed; it
+// reads and interprets the command byte that follows (WILL / WONT / DO /
+// DONT / SB / GA / a doubled IAC).
+func (r *internalDataReader) readCommand() (Event, error) {
+	b, err := r.readByte()
+	if nil != err {
+		return nil, err
+	}
+
+	switch b {
+	case IAC:
+		return DataEvent{Data: []byte{IAC}}, nil
+
+	case WILL:
+		opt, err := r.readByte()
+		if nil != err {
+			return nil, err
+		}
+		if err := r.receiveWill(opt); nil != err {
+			return nil, err
+		}
+		return WillEvent{Option: opt}, nil
+
+	case WONT:
+		opt, err := r.readByte()
+		if nil != err {
+			return nil, err
+		}
+		if err := r.receiveWont(opt); nil != err {
+			return nil, err
+		}
+		return WontEvent{Option: opt}, nil
+
+	case DO:
+		opt, err := r.readByte()
+		if nil != err {
+			return nil, err
+		}
+		if err := r.receiveDo(opt); nil != err {
+			return nil, err
+		}
+		return DoEvent{Option: opt}, nil
+
+	case DONT:
+		opt, err := r.readByte()
+		if nil != err {
+			return nil, err
 		}
+		if err := r.receiveDont(opt); nil != err {
+			return nil, err
+		}
+		return DontEvent{Option: opt}, nil
+
+	case SB:
+		return r.readSubnegotiation()
+
+	case GA, SE:
+		// A bare GA, or an SE outside of a subnegotiation; neither is
+		// user-facing, so just resume parsing.
+		return r.nextEvent()
+
 	default:
-		_, err := r.wrapped.Write([]byte{IAC, DONT, opt})
-		if err != nil {
-			return err
+		// If we get in here, this is not following the TELNET protocol.
+		//@TODO: Make a better error.
+		return nil, errCorrupted
+	}
+}
+
+// readSubnegotiation is called immediately after "IAC SB" has been
+// consumed. It reads the option byte and the payload up to "IAC SE",
+// un-escaping any doubled IAC bytes in the payload, and decodes it.
+func (r *internalDataReader) readSubnegotiation() (Event, error) {
+	opt, err := r.readByte()
+	if nil != err {
+		return nil, err
+	}
+
+	// COMPRESS2 doesn't carry a decodable payload: it hands the rest of
+	// the connection over to zlib. Handle it specially instead of
+	// collecting it as a normal payload.
+	if OPT_COMPRESS2 == opt {
+		return r.beginCompress2()
+	}
+
+	var payload []byte
+
+	for {
+		b, err := r.readByte()
+		if nil != err {
+			return nil, err
+		}
+
+		if IAC != b {
+			payload = append(payload, b)
+			continue
+		}
+
+		b2, err := r.readByte()
+		if nil != err {
+			return nil, err
+		}
+
+		if IAC == b2 {
+			payload = append(payload, IAC)
+			continue
+		}
+
+		// b2 == SE (or anything else) ends the subnegotiation.
+		break
+	}
+
+	if err := r.handlerFor(opt).OnSubnegotiation(payload); nil != err {
+		return nil, err
+	}
+
+	return decodeSubnegotiation(opt, payload)
+}
+
+// beginCompress2 reads to the end of "IAC SB COMPRESS2 IAC SE" and switches
+// the reader over to a zlib-compressed stream, per MCCP2.
+func (r *internalDataReader) beginCompress2() (Event, error) {
+	for {
+		b, err := r.buffered.ReadByte()
+		if nil != err {
+			return nil, err
+		}
+
+		if IAC != b {
+			continue
+		}
+
+		peeked, err := r.buffered.Peek(1)
+		if nil != err {
+			return nil, err
+		}
+
+		if SE == peeked[0] {
+			_, err = r.buffered.Discard(1)
+			if nil != err {
+				return nil, err
+			}
+			break
 		}
 	}
-	return nil
+
+	// Bytes the peer already pipelined into the same TCP segment as
+	// "IAC SE" are still sitting in r.buffered; read those before
+	// falling through to r.wrapped so nothing is lost. On a restart
+	// r.buffered is already the previous stream's rawSource, which reads
+	// (and counts) through to r.wrapped, so it is reused as it is rather
+	// than wrapped in a second counter that would count each byte twice.
+	if r.buffered != r.rawSource {
+		r.rawSource = bufio.NewReader(&countingReader{r: io.MultiReader(r.buffered, r.wrapped), n: &r.compressedBytesIn})
+	}
+
+	zReader, err := zlib.NewReader(r.rawSource)
+	if nil != err {
+		return nil, err
+	}
+	r.buffered = bufio.NewReader(&countingReader{r: zReader, n: &r.decompressedBytesOut})
+	r.compressed = true
+
+	return r.nextEvent()
+}
+
+// countingReader wraps an io.Reader, adding every byte it yields to *n.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
 }
@@ -0,0 +1,129 @@
+package telnet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+)
+
+// mustCompress zlib-compresses data into a standalone stream (with its
+// header and Close-terminated trailer), as a real MCCP2 peer would.
+func mustCompress(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); nil != err {
+		t.Fatalf("unexpected error compressing fixture: %v", err)
+	}
+	if err := zw.Close(); nil != err {
+		t.Fatalf("unexpected error closing fixture writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// compress2Announce is a raw (uncompressed) "IAC SB COMPRESS2 IAC SE",
+// exactly what a server sends to switch a stream over to MCCP2.
+var compress2Announce = []byte{IAC, SB, OPT_COMPRESS2, IAC, SE}
+
+// drainReader reads r to completion (until it returns an error, i.e. the
+// underlying connection running out of bytes), accumulating everything it
+// produced.
+func drainReader(r *internalDataReader) []byte {
+	var out []byte
+	buf := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		out = append(out, buf[:n]...)
+		if nil != err {
+			return out
+		}
+	}
+}
+
+func TestCompress2BasicRoundtrip(t *testing.T) {
+	var stream []byte
+	stream = append(stream, "hi "...)
+	stream = append(stream, compress2Announce...)
+	stream = append(stream, mustCompress(t, []byte("compressed-data"))...)
+
+	r := newDataReader(&loopbackConn{in: stream})
+	got := drainReader(r)
+
+	if want := "hi compressed-data"; want != string(got) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	in, out := r.Compress2Metrics()
+	if 0 == in || 0 == out {
+		t.Fatalf("Compress2Metrics() = (%d, %d), want both non-zero", in, out)
+	}
+}
+
+// TestCompress2SplitAcrossReads feeds the exact same stream as
+// TestCompress2BasicRoundtrip, but one byte at a time, to make sure the
+// state machine doesn't depend on a whole subnegotiation or zlib chunk
+// arriving in a single underlying Read.
+func TestCompress2SplitAcrossReads(t *testing.T) {
+	var stream []byte
+	stream = append(stream, "hi "...)
+	stream = append(stream, compress2Announce...)
+	stream = append(stream, mustCompress(t, []byte("compressed-data"))...)
+
+	r := newDataReader(&byteAtATimeConn{in: stream})
+	got := drainReader(r)
+
+	if want := "hi compressed-data"; want != string(got) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// TestCompress2RestartPreservesBufferedBytes reproduces the scenario this
+// request calls out explicitly: a MUD ends one COMPRESS2 stream and
+// immediately starts another (to reset the zlib dictionary) by sending the
+// plaintext restart announcement back-to-back with the compressed bytes
+// that follow it, all in the same TCP segment. Every byte must survive the
+// switch back to plaintext and forward into the second zlib stream - none
+// of it may be stranded in a bufio.Reader that gets discarded.
+func TestCompress2RestartPreservesBufferedBytes(t *testing.T) {
+	var stream []byte
+	stream = append(stream, "prefix "...)
+	stream = append(stream, compress2Announce...)
+	stream = append(stream, mustCompress(t, []byte("part1"))...)
+	stream = append(stream, compress2Announce...)
+	stream = append(stream, mustCompress(t, []byte("part2"))...)
+
+	// loopbackConn hands back the entire remaining stream on its first
+	// Read, so bufio loads all of it - including the second announcement
+	// and second zlib stream - into one buffer while still decompressing
+	// the first stream. That's exactly the layout that stranded bytes
+	// before this fix.
+	r := newDataReader(&loopbackConn{in: stream})
+	got := drainReader(r)
+
+	if want := "prefix part1part2"; want != string(got) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// byteAtATimeConn is an io.ReadWriter that yields at most one byte per
+// Read call, regardless of the caller's buffer size, to exercise parsing
+// across arbitrary I/O boundaries.
+type byteAtATimeConn struct {
+	in  []byte
+	out bytes.Buffer
+}
+
+func (c *byteAtATimeConn) Read(p []byte) (int, error) {
+	if 0 == len(c.in) {
+		return 0, io.EOF
+	}
+	p[0] = c.in[0]
+	c.in = c.in[1:]
+	return 1, nil
+}
+
+func (c *byteAtATimeConn) Write(p []byte) (int, error) {
+	return c.out.Write(p)
+}
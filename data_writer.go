@@ -0,0 +1,168 @@
+package telnet
+
+import (
+	"compress/zlib"
+	"io"
+)
+
+// OPT_COMPRESS3 is the MCCP3 option: unlike COMPRESS2 (which compresses
+// data the peer sends to us), COMPRESS3 compresses data *we* send to the
+// peer, so it is negotiated as a local ("us") option.
+const OPT_COMPRESS3 = 85
+
+// A DataWriter writes TELNET data to an underlying io.Writer, escaping any
+// 0xFF (IAC) byte in the data by doubling it - the inverse of what
+// internalDataReader un-escapes on the way in. It shares its negotiation
+// state with an EventReader (see NewDataWriter), so enabling or disabling
+// an option is consistent across both halves of a connection.
+type DataWriter struct {
+	wrapped io.Writer
+	reader  *internalDataReader
+
+	crlf bool
+
+	zWriter *zlib.Writer
+}
+
+// NewDataWriter creates a DataWriter writing to w, sharing events' Q
+// Method negotiation state.
+func NewDataWriter(w io.Writer, events *EventReader) *DataWriter {
+	return &DataWriter{
+		wrapped: w,
+		reader:  events.reader,
+	}
+}
+
+// Write escapes data per the TELNET protocol (doubling any IAC byte) and,
+// if CRLF mode is enabled, rewrites "\n" to "\r\n", before writing it to
+// the underlying io.Writer (or, once MCCP2 or MCCP3 compression has begun,
+// to the zlib stream wrapping it).
+func (w *DataWriter) Write(data []byte) (int, error) {
+	out := make([]byte, 0, len(data))
+
+	for _, b := range data {
+		if w.crlf && '\n' == b {
+			out = append(out, '\r', '\n')
+			continue
+		}
+		if IAC == b {
+			out = append(out, IAC, IAC)
+			continue
+		}
+		out = append(out, b)
+	}
+
+	if _, err := w.rawWrite(out); nil != err {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// SetCRLFMode toggles rewriting outbound "\n" to "\r\n", as ziutek/telnet
+// does for Unix-style callers talking to a CRLF-expecting peer.
+func (w *DataWriter) SetCRLFMode(enabled bool) {
+	w.crlf = enabled
+}
+
+// SendIAC sends a bare "IAC cmd opt" command, e.g. "IAC WILL NAWS".
+func (w *DataWriter) SendIAC(cmd, opt byte) error {
+	_, err := w.rawWrite([]byte{IAC, cmd, opt})
+	return err
+}
+
+// SendSubneg frames payload as "IAC SB opt <escaped payload> IAC SE",
+// doubling any IAC byte within payload.
+func (w *DataWriter) SendSubneg(opt byte, payload []byte) error {
+	buf := make([]byte, 0, len(payload)+5)
+	buf = append(buf, IAC, SB, opt)
+
+	for _, b := range payload {
+		if IAC == b {
+			buf = append(buf, IAC, IAC)
+			continue
+		}
+		buf = append(buf, b)
+	}
+
+	buf = append(buf, IAC, SE)
+
+	_, err := w.rawWrite(buf)
+	return err
+}
+
+// SendGA sends a bare "IAC GA" (go-ahead).
+func (w *DataWriter) SendGA() error {
+	_, err := w.rawWrite([]byte{IAC, GA})
+	return err
+}
+
+// EnableCompress3 asks the peer to let us compress our outbound data
+// (MCCP3): it registers the built-in COMPRESS3 handler and sends
+// "IAC WILL COMPRESS3". Compression of everything written after this call
+// begins transparently, once the peer agrees.
+func (w *DataWriter) EnableCompress3() error {
+	w.reader.RegisterOption(OPT_COMPRESS3, &compress3Handler{writer: w})
+	return w.reader.EnableLocal(OPT_COMPRESS3)
+}
+
+// EnableCompress2 asks the peer to let us compress our outbound data
+// (MCCP2): it registers a handler for OPT_COMPRESS2 and sends
+// "IAC WILL COMPRESS2". Compression of everything written after this call
+// begins transparently, once the peer agrees - this is the writer-side half
+// of MCCP2, whose reader side (decompressing a peer's own COMPRESS2
+// stream) is handled unconditionally by internalDataReader.beginCompress2.
+func (w *DataWriter) EnableCompress2() error {
+	w.reader.RegisterOption(OPT_COMPRESS2, &compress2Handler{writer: w})
+	return w.reader.EnableLocal(OPT_COMPRESS2)
+}
+
+// rawWrite writes p to the zlib stream once MCCP2 or MCCP3 compression has
+// begun, or directly to the underlying io.Writer otherwise.
+func (w *DataWriter) rawWrite(p []byte) (int, error) {
+	if nil != w.zWriter {
+		n, err := w.zWriter.Write(p)
+		if nil != err {
+			return n, err
+		}
+		return n, w.zWriter.Flush()
+	}
+
+	return w.wrapped.Write(p)
+}
+
+// compress3Handler is the OptionHandler registered for OPT_COMPRESS3 by
+// EnableCompress3; once the peer agrees to let us compress, it announces
+// the switch and starts wrapping writer's output in zlib, symmetric to how
+// internalDataReader.beginCompress2 switches the read side.
+type compress3Handler struct {
+	NoopOptionHandler
+
+	writer *DataWriter
+}
+
+func (h *compress3Handler) OnEnableLocal() error {
+	if err := h.writer.SendSubneg(OPT_COMPRESS3, nil); nil != err {
+		return err
+	}
+	h.writer.zWriter = zlib.NewWriter(h.writer.wrapped)
+	return nil
+}
+
+// compress2Handler is the OptionHandler registered for OPT_COMPRESS2 by
+// EnableCompress2; once the peer agrees to let us compress our output to
+// them, it announces the switch and starts wrapping writer's output in
+// zlib, same as compress3Handler does for the symmetric MCCP3 option.
+type compress2Handler struct {
+	NoopOptionHandler
+
+	writer *DataWriter
+}
+
+func (h *compress2Handler) OnEnableLocal() error {
+	if err := h.writer.SendSubneg(OPT_COMPRESS2, nil); nil != err {
+		return err
+	}
+	h.writer.zWriter = zlib.NewWriter(h.writer.wrapped)
+	return nil
+}
@@ -0,0 +1,110 @@
+package telnet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"testing"
+)
+
+func TestDataWriterEscapesIAC(t *testing.T) {
+	var out bytes.Buffer
+	w := NewDataWriter(&out, NewEventReader(&rwBuffer{out: &bytes.Buffer{}}))
+
+	n, err := w.Write([]byte{1, IAC, 2})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if 3 != n {
+		t.Fatalf("n = %d, want 3 (the un-escaped length)", n)
+	}
+	if want := []byte{1, IAC, IAC, 2}; !bytes.Equal(want, out.Bytes()) {
+		t.Fatalf("wrote %v, want %v", out.Bytes(), want)
+	}
+}
+
+func TestDataWriterCRLFMode(t *testing.T) {
+	var out bytes.Buffer
+	w := NewDataWriter(&out, NewEventReader(&rwBuffer{out: &bytes.Buffer{}}))
+	w.SetCRLFMode(true)
+
+	if _, err := w.Write([]byte("a\nb")); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "a\r\nb"; want != out.String() {
+		t.Fatalf("wrote %q, want %q", out.String(), want)
+	}
+}
+
+func TestDataWriterSendIAC(t *testing.T) {
+	var out bytes.Buffer
+	w := NewDataWriter(&out, NewEventReader(&rwBuffer{out: &bytes.Buffer{}}))
+
+	if err := w.SendIAC(WILL, OPT_NAWS); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []byte{IAC, WILL, OPT_NAWS}; !bytes.Equal(want, out.Bytes()) {
+		t.Fatalf("wrote %v, want %v", out.Bytes(), want)
+	}
+}
+
+func TestDataWriterSendSubnegEscapesPayload(t *testing.T) {
+	var out bytes.Buffer
+	w := NewDataWriter(&out, NewEventReader(&rwBuffer{out: &bytes.Buffer{}}))
+
+	if err := w.SendSubneg(OPT_TTYPE, []byte{0, IAC, 'x'}); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []byte{IAC, SB, OPT_TTYPE, 0, IAC, IAC, 'x', IAC, SE}
+	if !bytes.Equal(want, out.Bytes()) {
+		t.Fatalf("wrote %v, want %v", out.Bytes(), want)
+	}
+}
+
+func TestDataWriterSendGA(t *testing.T) {
+	var out bytes.Buffer
+	w := NewDataWriter(&out, NewEventReader(&rwBuffer{out: &bytes.Buffer{}}))
+
+	if err := w.SendGA(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []byte{IAC, GA}; !bytes.Equal(want, out.Bytes()) {
+		t.Fatalf("wrote %v, want %v", out.Bytes(), want)
+	}
+}
+
+// TestDataWriterCompress3 drives EnableCompress3 through its handler
+// directly (bypassing the network round-trip EnableLocal would normally
+// wait on) and checks that the COMPRESS3 announcement is sent in the clear
+// and everything written afterward arrives as a valid zlib stream.
+func TestDataWriterCompress3(t *testing.T) {
+	var out bytes.Buffer
+	events := NewEventReader(&rwBuffer{out: &bytes.Buffer{}})
+	w := NewDataWriter(&out, events)
+
+	h := &compress3Handler{writer: w}
+	if err := h.OnEnableLocal(); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	announce := []byte{IAC, SB, OPT_COMPRESS3, IAC, SE}
+	if !bytes.Equal(announce, out.Bytes()[:len(announce)]) {
+		t.Fatalf("announcement = %v, want %v", out.Bytes()[:len(announce)], announce)
+	}
+
+	if _, err := w.Write([]byte("hello")); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(out.Bytes()[len(announce):]))
+	if nil != err {
+		t.Fatalf("unexpected error opening zlib stream: %v", err)
+	}
+	got := make([]byte, len("hello"))
+	if _, err := io.ReadFull(zr, got); nil != err {
+		t.Fatalf("unexpected error reading zlib stream: %v", err)
+	}
+	if "hello" != string(got) {
+		t.Fatalf("decompressed %q, want %q", got, "hello")
+	}
+}
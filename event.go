@@ -0,0 +1,90 @@
+package telnet
+
+// An Event is one parsed unit of a TELNET stream, as produced by
+// EventReader: either a chunk of plain data, a bare option negotiation, or
+// a decoded subnegotiation.
+type Event interface {
+	isEvent()
+}
+
+// A DataEvent carries a chunk of plain (already un-escaped) application data.
+type DataEvent struct {
+	Data []byte
+}
+
+func (DataEvent) isEvent() {}
+
+// A WillEvent reports a bare "IAC WILL <opt>" negotiation from the peer.
+type WillEvent struct {
+	Option byte
+}
+
+func (WillEvent) isEvent() {}
+
+// A WontEvent reports a bare "IAC WONT <opt>" negotiation from the peer.
+type WontEvent struct {
+	Option byte
+}
+
+func (WontEvent) isEvent() {}
+
+// A DoEvent reports a bare "IAC DO <opt>" negotiation from the peer.
+type DoEvent struct {
+	Option byte
+}
+
+func (DoEvent) isEvent() {}
+
+// A DontEvent reports a bare "IAC DONT <opt>" negotiation from the peer.
+type DontEvent struct {
+	Option byte
+}
+
+func (DontEvent) isEvent() {}
+
+// A NAWSEvent reports a negotiated window size (option 31): the payload is
+// two 16-bit big-endian integers, width then height.
+type NAWSEvent struct {
+	W, H int
+}
+
+func (NAWSEvent) isEvent() {}
+
+// A TTypeEvent reports a terminal type announcement (option 24).
+type TTypeEvent struct {
+	Name string
+}
+
+func (TTypeEvent) isEvent() {}
+
+// An MSSPEvent reports MUD Server Status Protocol variables (option 70).
+type MSSPEvent struct {
+	Vars map[string]string
+}
+
+func (MSSPEvent) isEvent() {}
+
+// An EnvironmentEvent reports NEW-ENVIRON variables (option 39).
+type EnvironmentEvent struct {
+	Vars map[string]string
+}
+
+func (EnvironmentEvent) isEvent() {}
+
+// A ZMPEvent reports a Zenith MUD Protocol command (option 93): Command is
+// the first NUL-delimited string, Args are the rest.
+type ZMPEvent struct {
+	Command string
+	Args    []string
+}
+
+func (ZMPEvent) isEvent() {}
+
+// An UnknownSubnegotiationEvent reports a subnegotiation for an option this
+// package doesn't decode into a more specific Event.
+type UnknownSubnegotiationEvent struct {
+	Option  byte
+	Payload []byte
+}
+
+func (UnknownSubnegotiationEvent) isEvent() {}
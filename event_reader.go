@@ -0,0 +1,238 @@
+package telnet
+
+import (
+	"bytes"
+	"io"
+)
+
+// Option codes for the subnegotiations decoded into typed Events below.
+// OPT_COMPRESS2 is declared in data_reader.go alongside the other core
+// negotiation constants.
+const (
+	OPT_TTYPE = 24
+	OPT_NAWS  = 31
+	OPT_ENV   = 39
+	OPT_MSSP  = 70
+	OPT_ZMP   = 93
+)
+
+// An EventReader parses a raw TELNET byte stream into a sequence of Events
+// (WILL/WONT/DO/DONT negotiation, decoded subnegotiations such as NAWS,
+// TTYPE, MSSP, ENV and ZMP, and plain DataEvent chunks), so callers can
+// react to window-size changes, terminal type announcements, and MUD
+// extension protocols instead of only ever seeing data bytes.
+type EventReader struct {
+	reader *internalDataReader
+}
+
+// NewEventReader creates an EventReader reading from rw.
+func NewEventReader(rw io.ReadWriter) *EventReader {
+	return &EventReader{reader: newDataReader(rw)}
+}
+
+// NextEvent returns the next Event parsed from the stream.
+func (e *EventReader) NextEvent() (Event, error) {
+	return e.reader.nextEvent()
+}
+
+// RegisterOption installs h as the handler for opt; see OptionHandler.
+func (e *EventReader) RegisterOption(opt byte, h OptionHandler) {
+	e.reader.RegisterOption(opt, h)
+}
+
+// EnableRemote asks the peer to enable opt (sends IAC DO opt). Register a
+// handler for opt first to receive its callbacks; the peer's answering WILL
+// is accepted whether or not one is registered.
+func (e *EventReader) EnableRemote(opt byte) error {
+	return e.reader.EnableRemote(opt)
+}
+
+// DisableRemote asks the peer to disable opt (sends IAC DONT opt).
+func (e *EventReader) DisableRemote(opt byte) error {
+	return e.reader.DisableRemote(opt)
+}
+
+// EnableLocal asks to enable opt on our side (sends IAC WILL opt).
+func (e *EventReader) EnableLocal(opt byte) error {
+	return e.reader.EnableLocal(opt)
+}
+
+// DisableLocal asks to disable opt on our side (sends IAC WONT opt).
+func (e *EventReader) DisableLocal(opt byte) error {
+	return e.reader.DisableLocal(opt)
+}
+
+// Compressed reports whether the reader is currently decompressing a
+// COMPRESS2 (MCCP2) stream.
+func (e *EventReader) Compressed() bool {
+	return e.reader.Compressed()
+}
+
+// Compress2Metrics returns the number of raw bytes read from the connection
+// since the first COMPRESS2 stream began (bytesIn), and the number of
+// decompressed bytes produced (bytesOut). Both are totals over every
+// COMPRESS2 stream on the connection and are never reset.
+func (e *EventReader) Compress2Metrics() (bytesIn, bytesOut int64) {
+	return e.reader.Compress2Metrics()
+}
+
+// decodeSubnegotiation turns the payload of "IAC SB opt ... IAC SE" (with
+// doubled IACs already un-escaped) into a typed Event.
+func decodeSubnegotiation(opt byte, payload []byte) (Event, error) {
+	switch opt {
+	case OPT_NAWS:
+		if len(payload) < 4 {
+			return nil, errCorrupted
+		}
+		return NAWSEvent{
+			W: int(payload[0])<<8 | int(payload[1]),
+			H: int(payload[2])<<8 | int(payload[3]),
+		}, nil
+
+	case OPT_TTYPE:
+		if len(payload) < 1 {
+			return nil, errCorrupted
+		}
+		// payload[0] is the IS(0)/SEND(1) marker; the name follows.
+		return TTypeEvent{Name: string(payload[1:])}, nil
+
+	case OPT_MSSP:
+		return MSSPEvent{Vars: decodeMSSP(payload)}, nil
+
+	case OPT_ENV:
+		return EnvironmentEvent{Vars: decodeEnvironment(payload)}, nil
+
+	case OPT_ZMP:
+		return decodeZMP(payload), nil
+
+	default:
+		return UnknownSubnegotiationEvent{Option: opt, Payload: payload}, nil
+	}
+}
+
+// MSSP variable/value markers, per the MSSP specification.
+const (
+	msspVar = 1
+	msspVal = 2
+)
+
+// decodeMSSP parses alternating MSSP_VAR/MSSP_VAL delimited key/value pairs.
+func decodeMSSP(payload []byte) map[string]string {
+	vars := make(map[string]string)
+
+	var key string
+	var haveKey bool
+
+	for i := 0; i < len(payload); {
+		marker := payload[i]
+		i++
+
+		start := i
+		for i < len(payload) && payload[i] != msspVar && payload[i] != msspVal {
+			i++
+		}
+		value := payload[start:i]
+
+		switch marker {
+		case msspVar:
+			key = string(value)
+			haveKey = true
+		case msspVal:
+			if haveKey {
+				vars[key] = string(value)
+				haveKey = false
+			}
+		}
+	}
+
+	return vars
+}
+
+// NEW-ENVIRON request/reply marker (payload[0]) and field markers, per
+// RFC 1572.
+const (
+	envIs   = 0
+	envSend = 1
+	envInfo = 2
+
+	envVar     = 0
+	envValue   = 1
+	envEsc     = 2
+	envUserVar = 3
+)
+
+// decodeEnvironment parses a NEW-ENVIRON payload into a map of variable
+// name to value.
+func decodeEnvironment(payload []byte) map[string]string {
+	vars := make(map[string]string)
+	if len(payload) < 1 {
+		return vars
+	}
+
+	// payload[0] is the IS/SEND/INFO marker; the rest is a sequence of
+	// VAR|USERVAR <name> VALUE <value> groups, with ESC escaping a
+	// literal marker byte inside a name or value.
+	body := payload[1:]
+
+	var name, value []byte
+	var inValue, haveName bool
+
+	flush := func() {
+		if haveName {
+			vars[string(name)] = string(value)
+		}
+		name, value = nil, nil
+		inValue, haveName = false, false
+	}
+
+	for i := 0; i < len(body); i++ {
+		b := body[i]
+
+		switch b {
+		case envVar, envUserVar:
+			flush()
+			haveName = true
+		case envValue:
+			inValue = true
+		case envEsc:
+			i++
+			if i >= len(body) {
+				break
+			}
+			if inValue {
+				value = append(value, body[i])
+			} else {
+				name = append(name, body[i])
+			}
+		default:
+			if inValue {
+				value = append(value, b)
+			} else {
+				name = append(name, b)
+			}
+		}
+	}
+	flush()
+
+	return vars
+}
+
+// decodeZMP splits a ZMP payload on NUL bytes: the first string is the
+// command, the rest are its arguments.
+func decodeZMP(payload []byte) Event {
+	fields := bytes.Split(payload, []byte{0})
+	if n := len(fields); n > 0 && len(fields[n-1]) == 0 {
+		fields = fields[:n-1]
+	}
+
+	ev := ZMPEvent{}
+	for i, f := range fields {
+		if i == 0 {
+			ev.Command = string(f)
+			continue
+		}
+		ev.Args = append(ev.Args, string(f))
+	}
+
+	return ev
+}
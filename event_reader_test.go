@@ -0,0 +1,164 @@
+package telnet
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeSubnegotiation(t *testing.T) {
+	cases := []struct {
+		name    string
+		opt     byte
+		payload []byte
+		want    Event
+		wantErr bool
+	}{
+		{
+			name:    "NAWS",
+			opt:     OPT_NAWS,
+			payload: []byte{0x00, 0x50, 0x00, 0x18},
+			want:    NAWSEvent{W: 80, H: 24},
+		},
+		{
+			name:    "NAWS too short",
+			opt:     OPT_NAWS,
+			payload: []byte{0x00, 0x50},
+			wantErr: true,
+		},
+		{
+			name:    "TTYPE",
+			opt:     OPT_TTYPE,
+			payload: append([]byte{0}, "xterm"...),
+			want:    TTypeEvent{Name: "xterm"},
+		},
+		{
+			name:    "unknown option",
+			opt:     200,
+			payload: []byte{1, 2, 3},
+			want:    UnknownSubnegotiationEvent{Option: 200, Payload: []byte{1, 2, 3}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := decodeSubnegotiation(c.opt, c.payload)
+			if c.wantErr {
+				if nil == err {
+					t.Fatalf("expected error, got %#v", got)
+				}
+				return
+			}
+			if nil != err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %#v, want %#v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestDecodeMSSP(t *testing.T) {
+	payload := []byte{}
+	payload = append(payload, msspVar)
+	payload = append(payload, "NAME"...)
+	payload = append(payload, msspVal)
+	payload = append(payload, "TestMUD"...)
+	payload = append(payload, msspVar)
+	payload = append(payload, "PLAYERS"...)
+	payload = append(payload, msspVal)
+	payload = append(payload, "42"...)
+
+	want := map[string]string{"NAME": "TestMUD", "PLAYERS": "42"}
+	got := decodeMSSP(payload)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestDecodeEnvironment(t *testing.T) {
+	payload := []byte{envIs, envVar}
+	payload = append(payload, "USER"...)
+	payload = append(payload, envValue)
+	payload = append(payload, "root"...)
+	payload = append(payload, envUserVar)
+	payload = append(payload, "TERM"...)
+	payload = append(payload, envValue)
+	payload = append(payload, "xterm-256color"...)
+
+	want := map[string]string{"USER": "root", "TERM": "xterm-256color"}
+	got := decodeEnvironment(payload)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestDecodeZMP(t *testing.T) {
+	payload := bytes.Join([][]byte{[]byte("zmp.ping"), []byte("a"), []byte("b")}, []byte{0})
+	payload = append(payload, 0)
+
+	got := decodeZMP(payload)
+	want := ZMPEvent{Command: "zmp.ping", Args: []string{"a", "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestEventReaderNextEvent(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write([]byte("hello "))
+	stream.Write([]byte{IAC, SB, OPT_NAWS, 0x00, 0x50, 0x00, 0x18, IAC, SE})
+	stream.Write([]byte("world"))
+
+	conn := &loopbackConn{in: stream.Bytes()}
+	er := NewEventReader(conn)
+
+	ev, err := er.NextEvent()
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	de, ok := ev.(DataEvent)
+	if !ok || "hello " != string(de.Data) {
+		t.Fatalf("got %#v, want DataEvent{\"hello \"}", ev)
+	}
+
+	ev, err = er.NextEvent()
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if naws, ok := ev.(NAWSEvent); !ok || 80 != naws.W || 24 != naws.H {
+		t.Fatalf("got %#v, want NAWSEvent{80, 24}", ev)
+	}
+
+	ev, err = er.NextEvent()
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	de, ok = ev.(DataEvent)
+	if !ok || "world" != string(de.Data) {
+		t.Fatalf("got %#v, want DataEvent{\"world\"}", ev)
+	}
+}
+
+// loopbackConn is a minimal io.ReadWriter over a fixed input buffer, with
+// writes discarded; it stands in for a net.Conn in tests that only need to
+// drive the reader side.
+type loopbackConn struct {
+	in  []byte
+	out bytes.Buffer
+}
+
+func (c *loopbackConn) Read(p []byte) (int, error) {
+	if 0 == len(c.in) {
+		return 0, io.EOF
+	}
+	n := copy(p, c.in)
+	c.in = c.in[n:]
+	return n, nil
+}
+
+func (c *loopbackConn) Write(p []byte) (int, error) {
+	return c.out.Write(p)
+}
@@ -0,0 +1,266 @@
+package telnet
+
+// Q Method option negotiation, per RFC 1143. Each option tracks two
+// independent state variables: "us" (whether *we* have the option enabled,
+// driven by DO/DONT from the peer and the WILL/WONT we send back) and
+// "him" (whether the *peer* has the option enabled, driven by WILL/WONT
+// from the peer and the DO/DONT we send back). Besides the steady NO/YES
+// states, each variable can be mid-negotiation (WANTNO/WANTYES), and while
+// mid-negotiation a second, opposite request can be queued behind the
+// first (the "_OPPOSITE" states) instead of being sent immediately - this
+// is what keeps two peers that both start negotiating an option at once
+// from negotiate-looping forever.
+const (
+	optNo = iota
+	optYes
+	optWantNo
+	optWantYes
+	optWantNoOpposite
+	optWantYesOpposite
+)
+
+// An optionState is the pair of Q Method state variables for one option.
+type optionState struct {
+	us, him int
+}
+
+// An OptionHandler reacts to one TELNET option being enabled, disabled, or
+// receiving a subnegotiation. Register one with RegisterOption; an option
+// with no registered handler is refused when the peer offers it, though the
+// peer's answer to our own WILL or DO is accepted either way.
+type OptionHandler interface {
+	// OnEnableLocal is called once we have agreed to enable the option
+	// on our side (we sent or accepted a WILL).
+	OnEnableLocal() error
+	// OnDisableLocal is called once the option is disabled on our side.
+	OnDisableLocal() error
+	// OnEnableRemote is called once the peer has enabled the option
+	// (we sent or accepted a DO).
+	OnEnableRemote() error
+	// OnDisableRemote is called once the option is disabled on the
+	// peer's side.
+	OnDisableRemote() error
+	// OnSubnegotiation is called with the un-escaped payload of an
+	// "IAC SB opt ... IAC SE" block for this option.
+	OnSubnegotiation(payload []byte) error
+}
+
+// NoopOptionHandler implements OptionHandler with no-op methods, so a
+// built-in handler only needs to define the callbacks it cares about.
+type NoopOptionHandler struct{}
+
+func (NoopOptionHandler) OnEnableLocal() error            { return nil }
+func (NoopOptionHandler) OnDisableLocal() error           { return nil }
+func (NoopOptionHandler) OnEnableRemote() error           { return nil }
+func (NoopOptionHandler) OnDisableRemote() error          { return nil }
+func (NoopOptionHandler) OnSubnegotiation(_ []byte) error { return nil }
+
+// RegisterOption installs h as the handler for opt, replacing any
+// previously registered handler. An option with a registered handler is
+// agreed to whenever the peer offers to enable it; one without is refused.
+func (r *internalDataReader) RegisterOption(opt byte, h OptionHandler) {
+	if nil == r.handlers {
+		r.handlers = make(map[byte]OptionHandler)
+	}
+	r.handlers[opt] = h
+}
+
+func (r *internalDataReader) handlerFor(opt byte) OptionHandler {
+	if h, ok := r.handlers[opt]; ok {
+		return h
+	}
+	return NoopOptionHandler{}
+}
+
+func (r *internalDataReader) stateFor(opt byte) *optionState {
+	if nil == r.options {
+		r.options = make(map[byte]*optionState)
+	}
+	s, ok := r.options[opt]
+	if !ok {
+		s = &optionState{us: optNo, him: optNo}
+		r.options[opt] = s
+	}
+	return s
+}
+
+func (r *internalDataReader) send(cmd, opt byte) error {
+	_, err := r.wrapped.Write([]byte{IAC, cmd, opt})
+	return err
+}
+
+// receiveWill applies the RFC 1143 transition table for "him" to a
+// received "IAC WILL opt".
+func (r *internalDataReader) receiveWill(opt byte) error {
+	s := r.stateFor(opt)
+	_, registered := r.handlers[opt]
+
+	switch s.him {
+	case optNo:
+		if !registered {
+			return r.send(DONT, opt)
+		}
+		s.him = optYes
+		if err := r.send(DO, opt); nil != err {
+			return err
+		}
+		return r.handlerFor(opt).OnEnableRemote()
+
+	case optWantNo, optWantNoOpposite:
+		// The peer answered our DONT with WILL instead of WONT; per
+		// RFC 1143 this is an error, so just accept the new state. The
+		// option ends up enabled same as the optWantYes case below, so
+		// the handler needs the same OnEnableRemote callback.
+		s.him = optYes
+		return r.handlerFor(opt).OnEnableRemote()
+
+	case optWantYes:
+		s.him = optYes
+		return r.handlerFor(opt).OnEnableRemote()
+
+	case optWantYesOpposite:
+		s.him = optWantNo
+		return r.send(DONT, opt)
+	}
+
+	return nil
+}
+
+// receiveWont applies the RFC 1143 transition table for "him" to a
+// received "IAC WONT opt".
+func (r *internalDataReader) receiveWont(opt byte) error {
+	s := r.stateFor(opt)
+
+	switch s.him {
+	case optYes:
+		s.him = optNo
+		if err := r.send(DONT, opt); nil != err {
+			return err
+		}
+		return r.handlerFor(opt).OnDisableRemote()
+
+	case optWantNo, optWantYes, optWantYesOpposite:
+		s.him = optNo
+
+	case optWantNoOpposite:
+		s.him = optWantYes
+		return r.send(DO, opt)
+	}
+
+	return nil
+}
+
+// receiveDo applies the RFC 1143 transition table for "us" to a received
+// "IAC DO opt".
+func (r *internalDataReader) receiveDo(opt byte) error {
+	s := r.stateFor(opt)
+	_, registered := r.handlers[opt]
+
+	switch s.us {
+	case optNo:
+		if !registered {
+			return r.send(WONT, opt)
+		}
+		s.us = optYes
+		if err := r.send(WILL, opt); nil != err {
+			return err
+		}
+		return r.handlerFor(opt).OnEnableLocal()
+
+	case optWantNo, optWantNoOpposite:
+		// The peer answered our WONT with DO instead of DONT; per
+		// RFC 1143 this is an error, so just accept the new state. The
+		// option ends up enabled same as the optWantYes case below, so
+		// the handler needs the same OnEnableLocal callback.
+		s.us = optYes
+		return r.handlerFor(opt).OnEnableLocal()
+
+	case optWantYes:
+		s.us = optYes
+		return r.handlerFor(opt).OnEnableLocal()
+
+	case optWantYesOpposite:
+		s.us = optWantNo
+		return r.send(WONT, opt)
+	}
+
+	return nil
+}
+
+// receiveDont applies the RFC 1143 transition table for "us" to a received
+// "IAC DONT opt".
+func (r *internalDataReader) receiveDont(opt byte) error {
+	s := r.stateFor(opt)
+
+	switch s.us {
+	case optYes:
+		s.us = optNo
+		if err := r.send(WONT, opt); nil != err {
+			return err
+		}
+		return r.handlerFor(opt).OnDisableLocal()
+
+	case optWantNo, optWantYes, optWantYesOpposite:
+		s.us = optNo
+
+	case optWantNoOpposite:
+		s.us = optWantYes
+		return r.send(WILL, opt)
+	}
+
+	return nil
+}
+
+// EnableRemote asks the peer to enable opt (sends IAC DO opt), honoring
+// the current Q Method state so a request already in flight isn't
+// repeated.
+func (r *internalDataReader) EnableRemote(opt byte) error {
+	s := r.stateFor(opt)
+	switch s.him {
+	case optNo:
+		s.him = optWantYes
+		return r.send(DO, opt)
+	case optWantNo:
+		s.him = optWantNoOpposite
+	}
+	return nil
+}
+
+// DisableRemote asks the peer to disable opt (sends IAC DONT opt).
+func (r *internalDataReader) DisableRemote(opt byte) error {
+	s := r.stateFor(opt)
+	switch s.him {
+	case optYes:
+		s.him = optWantNo
+		return r.send(DONT, opt)
+	case optWantYes:
+		s.him = optWantYesOpposite
+	}
+	return nil
+}
+
+// EnableLocal asks to enable opt on our side (sends IAC WILL opt).
+func (r *internalDataReader) EnableLocal(opt byte) error {
+	s := r.stateFor(opt)
+	switch s.us {
+	case optNo:
+		s.us = optWantYes
+		return r.send(WILL, opt)
+	case optWantNo:
+		s.us = optWantNoOpposite
+	}
+	return nil
+}
+
+// DisableLocal asks to disable opt on our side (sends IAC WONT opt).
+func (r *internalDataReader) DisableLocal(opt byte) error {
+	s := r.stateFor(opt)
+	switch s.us {
+	case optYes:
+		s.us = optWantNo
+		return r.send(WONT, opt)
+	case optWantYes:
+		s.us = optWantYesOpposite
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package telnet
+
+import (
+	"bytes"
+	"testing"
+)
+
+// recordingHandler counts OptionHandler callback invocations so tests can
+// assert a callback fired (or didn't) without caring about its return value.
+type recordingHandler struct {
+	NoopOptionHandler
+
+	enableLocal, disableLocal   int
+	enableRemote, disableRemote int
+}
+
+func (h *recordingHandler) OnEnableLocal() error {
+	h.enableLocal++
+	return nil
+}
+
+func (h *recordingHandler) OnDisableLocal() error {
+	h.disableLocal++
+	return nil
+}
+
+func (h *recordingHandler) OnEnableRemote() error {
+	h.enableRemote++
+	return nil
+}
+
+func (h *recordingHandler) OnDisableRemote() error {
+	h.disableRemote++
+	return nil
+}
+
+func newTestReader() (*internalDataReader, *bytes.Buffer) {
+	var out bytes.Buffer
+	return newDataReader(&rwBuffer{out: &out}), &out
+}
+
+// rwBuffer is an io.ReadWriter with no readable input; tests drive the
+// negotiation state machine directly via receiveWill/receiveDo/etc. rather
+// than through Read, and only care about what gets written back.
+type rwBuffer struct {
+	out *bytes.Buffer
+}
+
+func (b *rwBuffer) Read(p []byte) (int, error)  { return 0, errCorrupted }
+func (b *rwBuffer) Write(p []byte) (int, error) { return b.out.Write(p) }
+
+func TestReceiveWillFromNo(t *testing.T) {
+	r, out := newTestReader()
+	h := &recordingHandler{}
+	r.RegisterOption(42, h)
+
+	if err := r.receiveWill(42); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if 1 != h.enableRemote {
+		t.Fatalf("OnEnableRemote called %d times, want 1", h.enableRemote)
+	}
+	if want := []byte{IAC, DO, 42}; !bytes.Equal(want, out.Bytes()) {
+		t.Fatalf("wrote %v, want %v", out.Bytes(), want)
+	}
+}
+
+func TestReceiveWillFromNoUnregisteredRefuses(t *testing.T) {
+	r, out := newTestReader()
+
+	if err := r.receiveWill(42); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []byte{IAC, DONT, 42}; !bytes.Equal(want, out.Bytes()) {
+		t.Fatalf("wrote %v, want %v", out.Bytes(), want)
+	}
+}
+
+// TestReceiveWillAnsweringWantNo covers the case where we've asked the peer
+// to disable an option (sent DONT, state WANTNO) and the peer answers with
+// WILL instead of WONT. RFC 1143 treats this as an error and just accepts
+// the option as enabled, so the handler must still see OnEnableRemote -
+// nothing else will ever tell it the option is live.
+func TestReceiveWillAnsweringWantNo(t *testing.T) {
+	r, _ := newTestReader()
+	h := &recordingHandler{}
+	r.RegisterOption(42, h)
+	r.stateFor(42).him = optWantNo
+
+	if err := r.receiveWill(42); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if optYes != r.stateFor(42).him {
+		t.Fatalf("him = %d, want optYes", r.stateFor(42).him)
+	}
+	if 1 != h.enableRemote {
+		t.Fatalf("OnEnableRemote called %d times, want 1", h.enableRemote)
+	}
+}
+
+func TestReceiveWillAnsweringWantNoOpposite(t *testing.T) {
+	r, _ := newTestReader()
+	h := &recordingHandler{}
+	r.RegisterOption(42, h)
+	r.stateFor(42).him = optWantNoOpposite
+
+	if err := r.receiveWill(42); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if 1 != h.enableRemote {
+		t.Fatalf("OnEnableRemote called %d times, want 1", h.enableRemote)
+	}
+}
+
+func TestReceiveDoAnsweringWantNo(t *testing.T) {
+	r, _ := newTestReader()
+	h := &recordingHandler{}
+	r.RegisterOption(42, h)
+	r.stateFor(42).us = optWantNo
+
+	if err := r.receiveDo(42); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if optYes != r.stateFor(42).us {
+		t.Fatalf("us = %d, want optYes", r.stateFor(42).us)
+	}
+	if 1 != h.enableLocal {
+		t.Fatalf("OnEnableLocal called %d times, want 1", h.enableLocal)
+	}
+}
+
+func TestEnableRemoteAvoidsNegotiationLoop(t *testing.T) {
+	r, out := newTestReader()
+
+	if err := r.EnableRemote(42); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []byte{IAC, DO, 42}; !bytes.Equal(want, out.Bytes()) {
+		t.Fatalf("wrote %v, want %v", out.Bytes(), want)
+	}
+	out.Reset()
+
+	// A second EnableRemote while the first is still in flight must not
+	// send another DO; the repeat request is ignored.
+	if err := r.EnableRemote(42); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if 0 != out.Len() {
+		t.Fatalf("wrote %v, want nothing", out.Bytes())
+	}
+}
+
+func TestReceiveWontFromYes(t *testing.T) {
+	r, out := newTestReader()
+	h := &recordingHandler{}
+	r.RegisterOption(42, h)
+	r.stateFor(42).him = optYes
+
+	if err := r.receiveWont(42); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if 1 != h.disableRemote {
+		t.Fatalf("OnDisableRemote called %d times, want 1", h.disableRemote)
+	}
+	if want := []byte{IAC, DONT, 42}; !bytes.Equal(want, out.Bytes()) {
+		t.Fatalf("wrote %v, want %v", out.Bytes(), want)
+	}
+}